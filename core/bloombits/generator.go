@@ -0,0 +1,81 @@
+// Copyright 2017 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import "errors"
+
+// errSectionOutOfBounds is returned if the user tries to add more bloom
+// filters to the generator than the maximum number of slots configured for a
+// section.
+var errSectionOutOfBounds = errors.New("section out of bounds")
+
+// Generator takes a number of bloom filters and generates the rotated
+// bloom bits to be used for batched filtering.
+type Generator struct {
+	blooms   [2048][]byte // Rotated blooms for per-bit matching
+	sections uint         // Number of sections to batch together
+	nextBit  uint         // Next bit index to fill in the rotated blooms
+}
+
+// NewGenerator creates a rotated bloom generator that can iteratively fill a
+// batched bloom filter's bits.
+func NewGenerator(sections uint) (*Generator, error) {
+	if sections%8 != 0 {
+		return nil, errors.New("section count not multiple of 8")
+	}
+	b := &Generator{sections: sections}
+	for i := 0; i < len(b.blooms); i++ {
+		b.blooms[i] = make([]byte, sections/8)
+	}
+	return b, nil
+}
+
+// AddBloom takes a single bloom filter and sets the corresponding bit column
+// in memory accordingly.
+func (b *Generator) AddBloom(index uint, bloom [256]byte) error {
+	if b.nextBit != index {
+		return errors.New("bloom filter with unexpected index")
+	}
+	if b.nextBit >= b.sections {
+		return errSectionOutOfBounds
+	}
+	byteIndex := b.nextBit / 8
+	bitMask := byte(1) << byte(7-b.nextBit%8)
+
+	for i := 0; i < 2048; i++ {
+		bloomByteIndex := 256 - 1 - i/8
+		bloomBitMask := byte(1) << byte(i%8)
+
+		if bloom[bloomByteIndex]&bloomBitMask != 0 {
+			b.blooms[i][byteIndex] |= bitMask
+		}
+	}
+	b.nextBit++
+	return nil
+}
+
+// Bitset returns the bit vector belonging to the given bit index after all
+// blooms have been added.
+func (b *Generator) Bitset(idx uint) ([]byte, error) {
+	if b.nextBit != b.sections {
+		return nil, errors.New("bloom not fully generated yet")
+	}
+	if idx >= 2048 {
+		return nil, errors.New("bit index out of bounds")
+	}
+	return b.blooms[idx], nil
+}
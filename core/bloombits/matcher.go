@@ -0,0 +1,288 @@
+// Copyright 2017 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bloombits implements bloom filtering on batches of data.
+package bloombits
+
+import (
+	"context"
+	"sync"
+
+	"github.com/abt/zerium/crypto"
+)
+
+// bloomIndexes represents the bit indexes inside the bloom filter that
+// belong to some key.
+type bloomIndexes [3]uint
+
+// calcBloomIndexes returns the bloom filter bit indexes belonging to the
+// given key.
+func calcBloomIndexes(b []byte) bloomIndexes {
+	b = crypto.Keccak256(b)
+
+	var idxs bloomIndexes
+	for i := 0; i < len(idxs); i++ {
+		idxs[i] = (uint(b[2*i])<<8)&2047 + uint(b[2*i+1])
+	}
+	return idxs
+}
+
+// Retrieval represents a request for retrieval task to be performed by the
+// request's servicer, and returned with the requested bits set in place. One
+// Retrieval is handed to a bloomRequests consumer (see
+// Zerium.startBloomHandlers) at a time.
+type Retrieval struct {
+	Bit      uint
+	Sections []uint64
+	Bitsets  [][]byte
+	Error    error
+}
+
+// Matcher is a pipelined structure of rotated bloom filters that is used to
+// match the 3-bit-per-key bloom filter values used by Zerium addresses and
+// topics, resolving to the specific block numbers within a section that
+// potentially contain matches.
+type Matcher struct {
+	sectionSize uint64 // Size of the data batches to filter on, in blocks
+
+	filters    [][]bloomIndexes    // Filter the system is matching for
+	schedulers map[uint]*scheduler // Retrieval schedulers for each bit required
+}
+
+// NewMatcher creates a new pipeline for retrieving bloom bit masks and
+// matching them against a set of requested rules.
+func NewMatcher(sectionSize uint64, filters [][][]byte) *Matcher {
+	m := &Matcher{
+		sectionSize: sectionSize,
+		schedulers:  make(map[uint]*scheduler),
+	}
+	m.setFilters(filters)
+	return m
+}
+
+// setFilters converts the raw filter rules (OR-ed lists of AND-ed byte
+// slices such as [][]common.Address / [][]common.Hash) into the bit indexes
+// the bloom filter actually stores them at, and wires up a scheduler per
+// distinct bit so concurrent sessions can share in-flight retrievals.
+func (m *Matcher) setFilters(filters [][][]byte) {
+	for _, filter := range filters {
+		bloomFilter := make([]bloomIndexes, len(filter))
+		for i, clause := range filter {
+			bloomFilter[i] = calcBloomIndexes(clause)
+		}
+		m.filters = append(m.filters, bloomFilter)
+	}
+	for _, bloomFilter := range m.filters {
+		for _, bits := range bloomFilter {
+			for _, bit := range bits {
+				if _, ok := m.schedulers[bit]; !ok {
+					m.schedulers[bit] = newScheduler(bit)
+				}
+			}
+		}
+	}
+}
+
+// RequiredBits returns every bit index this matcher needs a section bitset
+// for, so a caller can fetch them all before calling Match.
+func (m *Matcher) RequiredBits() []uint {
+	bits := make([]uint, 0, len(m.schedulers))
+	for bit := range m.schedulers {
+		bits = append(bits, bit)
+	}
+	return bits
+}
+
+// Match combines a section's per-bit bloom vectors (bitsets, each
+// m.sectionSize bits long, one bit per block in the section) according to
+// the matcher's filter rules - AND across clauses (address, topic0, topic1,
+// ...), OR within a clause, AND across the 3 bits belonging to one value -
+// and returns the block numbers *relative to the section's first block*
+// that satisfy every clause. A block's bit has to actually be set at its
+// own position, not merely somewhere in the vector, or every block in a
+// matched section would wrongly be reported as a hit.
+func (m *Matcher) Match(bitsets map[uint][]byte) []uint64 {
+	if len(m.filters) == 0 {
+		return nil
+	}
+	bytesPerVector := int(m.sectionSize+7) / 8
+
+	var combined []byte
+	for _, bloomFilter := range m.filters {
+		var clauseVec []byte
+		for _, bits := range bloomFilter {
+			valueVec := onesVec(bytesPerVector)
+			for _, bit := range bits {
+				andInto(valueVec, bitsets[bit])
+			}
+			clauseVec = orVec(clauseVec, valueVec, bytesPerVector)
+		}
+		if combined == nil {
+			combined = clauseVec
+		} else {
+			andInto(combined, clauseVec)
+		}
+	}
+	var matches []uint64
+	for i := uint64(0); i < m.sectionSize; i++ {
+		if bitSet(combined, i) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func onesVec(n int) []byte {
+	v := make([]byte, n)
+	for i := range v {
+		v[i] = 0xff
+	}
+	return v
+}
+
+// andInto ANDs src into dst in place; a missing/short src is treated as all
+// zero, matching no block.
+func andInto(dst, src []byte) {
+	for i := range dst {
+		if i >= len(src) {
+			dst[i] = 0
+			continue
+		}
+		dst[i] &= src[i]
+	}
+}
+
+// orVec ORs src into dst (allocating dst on first use) and returns it.
+func orVec(dst, src []byte, n int) []byte {
+	if dst == nil {
+		dst = make([]byte, n)
+	}
+	for i := 0; i < n && i < len(src); i++ {
+		dst[i] |= src[i]
+	}
+	return dst
+}
+
+// bitSet reports whether bit i (big-endian within each byte) is set in vec.
+func bitSet(vec []byte, i uint64) bool {
+	byteIndex := i / 8
+	if int(byteIndex) >= len(vec) {
+		return false
+	}
+	bitMask := byte(1) << byte(7-i%8)
+	return vec[byteIndex]&bitMask != 0
+}
+
+// scheduler handles the scheduling of bloom-filter retrieval operations for
+// a single bit index, deduplicating requests that arrive from multiple
+// concurrent matcher sessions for the same bit/section pair: whichever
+// caller first asks for a section owns fetching it, and every other caller
+// that asks for the same section while it's in flight rides along on that
+// single fetch instead of triggering a duplicate one.
+type scheduler struct {
+	bit     uint
+	lock    sync.Mutex
+	pending map[uint64]*pendingSection // Sections currently in flight, keyed by section index
+}
+
+// pendingSection is shared by every caller waiting on the same in-flight
+// section: the goroutine that owns the fetch (the one that found no entry
+// yet) sets bitset/err and closes done; every other caller just waits on
+// done and then reads the result, rather than issuing its own request.
+type pendingSection struct {
+	done   chan struct{}
+	bitset []byte
+	err    error
+}
+
+func newScheduler(bit uint) *scheduler {
+	return &scheduler{bit: bit, pending: make(map[uint64]*pendingSection)}
+}
+
+// run requests every section in sections that isn't already in flight for
+// this bit, forwarding the deduplicated batch onto dist - the shared
+// channel serviced by Zerium.startBloomHandlers - and blocks until every
+// section in sections has been resolved, whether this call's own fetch
+// produced it or it rode along on another concurrently running session's
+// in-flight request for the same section. Exactly one Retrieval, covering
+// every section asked for (in the same order), is sent on deliver, unless
+// ctx is done first, in which case nothing is sent.
+func (s *scheduler) run(ctx context.Context, sections []uint64, dist chan chan *Retrieval, deliver chan *Retrieval) {
+	s.lock.Lock()
+	pending := make(map[uint64]*pendingSection, len(sections))
+	var fresh []uint64
+	for _, section := range sections {
+		if p, ok := s.pending[section]; ok {
+			pending[section] = p
+			continue
+		}
+		p := &pendingSection{done: make(chan struct{})}
+		s.pending[section] = p
+		pending[section] = p
+		fresh = append(fresh, section)
+	}
+	s.lock.Unlock()
+
+	if len(fresh) > 0 {
+		// request is unbuffered so the task sent on it can only be received
+		// by the servicer, never read back here. Once dist has accepted the
+		// request the servicer always answers, so the reply is awaited.
+		request := make(chan *Retrieval)
+
+		var res *Retrieval
+		select {
+		case dist <- request:
+			request <- &Retrieval{Bit: s.bit, Sections: fresh}
+			res = <-request
+		case <-ctx.Done():
+		}
+
+		s.lock.Lock()
+		for i, section := range fresh {
+			p := pending[section]
+			switch {
+			case res == nil:
+				p.err = ctx.Err()
+			case res.Error != nil:
+				p.err = res.Error
+			case i < len(res.Bitsets):
+				p.bitset = res.Bitsets[i]
+			}
+			delete(s.pending, section)
+			close(p.done)
+		}
+		s.lock.Unlock()
+	}
+
+	result := &Retrieval{Bit: s.bit, Sections: sections, Bitsets: make([][]byte, len(sections))}
+	for i, section := range sections {
+		p := pending[section]
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return
+		}
+		if p.err != nil {
+			result.Error = p.err
+			break
+		}
+		result.Bitsets[i] = p.bitset
+	}
+	select {
+	case deliver <- result:
+	case <-ctx.Done():
+	}
+}
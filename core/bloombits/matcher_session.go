@@ -0,0 +1,166 @@
+// Copyright 2017 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errSessionNotStarted is returned by Next if the session was never handed a
+// retrieval channel via Start.
+var errSessionNotStarted = errors.New("bloombits: matcher session not started")
+
+// MatcherSession is returned by a Matcher to iterate over a concrete,
+// bounded section range, sharing the matcher's per-bit schedulers (and so
+// its in-flight retrievals) with any other concurrently running session on
+// the same matcher.
+type MatcherSession struct {
+	matcher *Matcher
+
+	begin, end uint64 // Block number range this session covers
+	cursor     uint64
+
+	dist       chan chan *Retrieval // Shared channel serviced by Zerium.startBloomHandlers, set by Start
+	deliveries chan *Retrieval
+
+	curSection uint64   // Section the cached bits/matches below belong to
+	bits       map[uint][]byte
+	matches    []uint64 // Matching block offsets (relative to curSection's first block)
+	matchIdx   int
+
+	err  error
+	once sync.Once
+	done chan struct{} // Closed by Close to cancel any fetchSection in flight
+}
+
+// NewMatcherSession starts a session against matcher, bounded to the
+// [begin, end] block range. The session can't retrieve anything until
+// Start is called with the channel its retrievals should be serviced on.
+func NewMatcherSession(matcher *Matcher, begin, end uint64) *MatcherSession {
+	return &MatcherSession{
+		matcher:    matcher,
+		begin:      begin,
+		end:        end,
+		cursor:     begin,
+		deliveries: make(chan *Retrieval),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start hands the session the channel its bit retrievals should be
+// submitted on - in practice zrm.bloomRequests, serviced by the goroutines
+// Zerium.startBloomHandlers spins up, so concurrent sessions' requests
+// coalesce through the same servicing pool instead of each session reading
+// the database independently.
+func (s *MatcherSession) Start(bloomRequests chan chan *Retrieval) {
+	s.dist = bloomRequests
+}
+
+// Next advances the session to the next block number within [begin, end]
+// whose bloom bits actually match the filter criteria at that specific
+// block, not merely somewhere within its section. It blocks until whatever
+// section that block falls in has had its bits retrieved and matched.
+func (s *MatcherSession) Next(ctx context.Context) (uint64, bool) {
+	if s.dist == nil {
+		s.err = errSessionNotStarted
+		return 0, false
+	}
+	for s.cursor <= s.end {
+		section := s.cursor / s.matcher.sectionSize
+		if s.bits == nil || section != s.curSection {
+			if err := s.fetchSection(ctx, section); err != nil {
+				s.err = err
+				return 0, false
+			}
+			s.curSection = section
+			s.matches = s.matcher.Match(s.bits)
+			s.matchIdx = 0
+		}
+
+		base := section * s.matcher.sectionSize
+		for s.matchIdx < len(s.matches) {
+			abs := base + s.matches[s.matchIdx]
+			s.matchIdx++
+			if abs < s.cursor {
+				continue
+			}
+			if abs > s.end {
+				return 0, false
+			}
+			s.cursor = abs + 1
+			return abs, true
+		}
+		// Exhausted this section's matches (or it had none); move on.
+		s.cursor = base + s.matcher.sectionSize
+		s.bits = nil
+	}
+	return 0, false
+}
+
+// fetchSection retrieves every bit this matcher needs for section, blocking
+// until all of them have been delivered. It derives its own context from ctx
+// so that Close, called from another goroutine, actually aborts any
+// schedulers.run calls this fetch is waiting on instead of only ever being
+// cancellable by the caller's own ctx.
+func (s *MatcherSession) fetchSection(ctx context.Context, section uint64) error {
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-fetchCtx.Done():
+		}
+	}()
+
+	bits := s.matcher.RequiredBits()
+	s.bits = make(map[uint][]byte, len(bits))
+
+	for _, bit := range bits {
+		go s.matcher.schedulers[bit].run(fetchCtx, []uint64{section}, s.dist, s.deliveries)
+	}
+	for range bits {
+		select {
+		case res := <-s.deliveries:
+			if res.Error != nil {
+				return res.Error
+			}
+			for i, sec := range res.Sections {
+				if sec == section && i < len(res.Bitsets) {
+					s.bits[res.Bit] = res.Bitsets[i]
+				}
+			}
+		case <-fetchCtx.Done():
+			return fetchCtx.Err()
+		}
+	}
+	return nil
+}
+
+// Error returns any error encountered while servicing this session.
+func (s *MatcherSession) Error() error {
+	return s.err
+}
+
+// Close terminates the session, cancelling whichever fetchSection call (if
+// any) is currently in flight on its behalf instead of leaving it to run
+// until the caller's own ctx is done.
+func (s *MatcherSession) Close() {
+	s.once.Do(func() { close(s.done) })
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestMatcherMatchNarrowsToBlock checks that Match only reports the blocks
+// whose own bit is actually set, not every block in a section that has the
+// bit set anywhere.
+func TestMatcherMatchNarrowsToBlock(t *testing.T) {
+	m := &Matcher{
+		sectionSize: 8,
+		filters:     [][]bloomIndexes{{{3, 3, 3}}},
+	}
+	// Only bit 3 set (big-endian within the byte, mask 1<<(7-3)): only
+	// block 3 should match this single-bit filter, not any other block.
+	got := m.Match(map[uint][]byte{3: {0x10}})
+	want := []uint64{3}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Match() = %v, want %v", got, want)
+	}
+}
+
+// TestMatcherSessionNextAcrossSections runs a MatcherSession over two
+// sections with different matching blocks in each, using a fake servicer in
+// place of Zerium.startBloomHandlers, and checks that Next walks out exactly
+// the matching absolute block numbers - not every block of a matched
+// section, which was the bug fixed alongside this test.
+func TestMatcherSessionNextAcrossSections(t *testing.T) {
+	m := NewMatcher(8, [][][]byte{{[]byte("value")}})
+
+	// Section 0: only relative block 2 matches. Section 1: relative blocks
+	// 0 and 5 match.
+	sectionBits := map[uint64][]byte{
+		0: {0x20}, // bit 2 set
+		1: {0x84}, // bits 0 and 5 set
+	}
+
+	dist := make(chan chan *Retrieval)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case req := <-dist:
+				r := <-req
+				bits := make([][]byte, len(r.Sections))
+				for i, sec := range r.Sections {
+					bits[i] = sectionBits[sec]
+				}
+				req <- &Retrieval{Bit: r.Bit, Sections: r.Sections, Bitsets: bits}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	session := NewMatcherSession(m, 0, 15)
+	session.Start(dist)
+
+	var got []uint64
+	for {
+		block, ok := session.Next(ctx)
+		if !ok {
+			break
+		}
+		got = append(got, block)
+	}
+	if err := session.Error(); err != nil {
+		t.Fatalf("session error: %v", err)
+	}
+	want := []uint64{2, 8, 13}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Next() walked %v, want %v", got, want)
+	}
+}
+
+// TestSchedulerDedupDeliversToAllWaiters checks that when a second run()
+// call for a section already in flight gets deduplicated (the "fresh" list
+// empty case), it still receives the delivery once the in-flight fetch
+// completes, rather than blocking forever - the bug that motivated this
+// test: only the caller that actually owned the fetch used to be woken.
+func TestSchedulerDedupDeliversToAllWaiters(t *testing.T) {
+	s := newScheduler(7)
+	dist := make(chan chan *Retrieval)
+	release := make(chan struct{})
+
+	go func() {
+		req := <-dist
+		r := <-req
+		<-release // hold the fetch open until both run() calls are waiting on it
+		req <- &Retrieval{Bit: r.Bit, Sections: r.Sections, Bitsets: [][]byte{{0xab}}}
+	}()
+
+	ctx := context.Background()
+	deliver1 := make(chan *Retrieval, 1)
+	deliver2 := make(chan *Retrieval, 1)
+
+	go s.run(ctx, []uint64{3}, dist, deliver1)
+
+	// Spin until the first call has registered section 3 as pending, so the
+	// second call finds it there instead of racing the first for ownership
+	// of the fetch.
+	for {
+		s.lock.Lock()
+		_, pending := s.pending[3]
+		s.lock.Unlock()
+		if pending {
+			break
+		}
+		runtime.Gosched()
+	}
+	go s.run(ctx, []uint64{3}, dist, deliver2)
+	// Give the second call time to join the pending fetch before releasing
+	// it; otherwise the first call can finish and remove section 3 from
+	// pending first, and the second call then starts a fetch nobody serves.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	for i, deliver := range []chan *Retrieval{deliver1, deliver2} {
+		select {
+		case res := <-deliver:
+			if res.Error != nil {
+				t.Fatalf("delivery %d: unexpected error %v", i, res.Error)
+			}
+			if len(res.Bitsets) != 1 || len(res.Bitsets[0]) != 1 || res.Bitsets[0][0] != 0xab {
+				t.Fatalf("delivery %d: got bitsets %v, want [[0xab]]", i, res.Bitsets)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("delivery %d: never arrived - dedup waiter hung", i)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import "fmt"
+
+// NewJSTracer is meant to build a Tracer driven by a user-supplied
+// JavaScript snippet defining step(log, db), fault(log, db) and
+// result(ctx, db) callbacks, evaluated against a limited op/db API - the
+// second tracer flavor debug_trace* accepts alongside the default
+// StructLogger.
+//
+// Evaluating that snippet requires an embedded JS runtime (upstream Zerium
+// vendors robertkrimen/otto for this). This tree has no dependency manifest
+// or vendor directory to pull one in, so NewJSTracer fails fast with a
+// descriptive error instead of silently no-op'ing or partially executing
+// the snippet - callers should fall back to the struct logger
+// (NewStructLogger) until a JS runtime is wired in here.
+func NewJSTracer(code string) (Tracer, error) {
+	if code == "" {
+		return nil, fmt.Errorf("vm: empty JS tracer source")
+	}
+	return nil, fmt.Errorf("vm: JS tracer support requires an embedded JS runtime that isn't vendored in this build; use the default struct logger instead")
+}
@@ -0,0 +1,142 @@
+// Copyright 2015 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/abt/zerium/common"
+)
+
+// LogConfig configures how much detail StructLogger captures per opcode.
+// All three are opt-out: a node tracing a contract with large memory/stack
+// usage will typically disable whichever it doesn't need, since capturing
+// and JSON-encoding them on every step of a long-running call is the
+// dominant cost of a trace.
+type LogConfig struct {
+	DisableMemory  bool
+	DisableStack   bool
+	DisableStorage bool
+}
+
+// StructLog is a structured log emitted by StructLogger for a single
+// executed opcode.
+type StructLog struct {
+	Pc      uint64                      `json:"pc"`
+	Op      byte                        `json:"op"`
+	Gas     uint64                      `json:"gas"`
+	GasCost uint64                      `json:"gasCost"`
+	Depth   int                         `json:"depth"`
+	Error   string                      `json:"error,omitempty"`
+	Stack   []*big.Int                  `json:"stack,omitempty"`
+	Memory  []byte                      `json:"memory,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// StructLogger is the default Tracer: it records one StructLog per executed
+// opcode, same shape as the debug_traceTransaction response prior to any
+// custom (JS) tracer being plugged in.
+type StructLogger struct {
+	cfg LogConfig
+
+	logs   []StructLog
+	output []byte
+	err    error
+
+	mu      sync.Mutex
+	stopErr error
+}
+
+// NewStructLogger returns a Tracer that records every opcode's state
+// according to cfg. A nil cfg captures everything.
+func NewStructLogger(cfg *LogConfig) *StructLogger {
+	logger := &StructLogger{}
+	if cfg != nil {
+		logger.cfg = *cfg
+	}
+	return logger
+}
+
+func (l *StructLogger) CaptureStart(from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (l *StructLogger) CaptureState(pc uint64, op byte, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) error {
+	if stopErr := l.stopped(); stopErr != nil {
+		return stopErr
+	}
+	log := StructLog{Pc: pc, Op: op, Gas: gas, GasCost: cost, Depth: depth}
+	if err != nil {
+		log.Error = err.Error()
+	}
+	if scope != nil {
+		if !l.cfg.DisableStack {
+			log.Stack = scope.Stack
+		}
+		if !l.cfg.DisableMemory {
+			log.Memory = scope.Memory
+		}
+		if !l.cfg.DisableStorage && scope.Contract != nil {
+			log.Storage = scope.Contract.Storage
+		}
+	}
+	l.logs = append(l.logs, log)
+	return nil
+}
+
+func (l *StructLogger) CaptureFault(pc uint64, op byte, gas, cost uint64, scope *ScopeContext, depth int, err error) error {
+	return l.CaptureState(pc, op, gas, cost, scope, nil, depth, err)
+}
+
+func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, err error) error {
+	l.output = output
+	l.err = err
+	return nil
+}
+
+// GetResult returns every captured StructLog in execution order.
+func (l *StructLogger) GetResult() (interface{}, error) {
+	if stopErr := l.stopped(); stopErr != nil {
+		return nil, stopErr
+	}
+	return struct {
+		StructLogs []StructLog `json:"structLogs"`
+		Failed     bool        `json:"failed"`
+		ReturnData []byte      `json:"returnValue"`
+	}{
+		StructLogs: l.logs,
+		Failed:     l.err != nil,
+		ReturnData: l.output,
+	}, nil
+}
+
+// Stop aborts the trace, surfacing err from the next CaptureState/
+// CaptureFault call and from GetResult.
+func (l *StructLogger) Stop(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopErr == nil {
+		l.stopErr = err
+	}
+}
+
+func (l *StructLogger) stopped() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stopErr
+}
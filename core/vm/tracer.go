@@ -0,0 +1,58 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/abt/zerium/common"
+)
+
+// Tracer is implemented by EVM execution observers plugged in via
+// Config.Tracer. The EVM interpreter calls CaptureState once per executed
+// opcode, CaptureFault when an opcode errors out, and CaptureEnd once the
+// call returns; Stop lets a caller abort an in-progress trace (e.g. on
+// timeout) from another goroutine.
+type Tracer interface {
+	CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error
+	CaptureState(pc uint64, op byte, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) error
+	CaptureFault(pc uint64, op byte, gas, cost uint64, scope *ScopeContext, depth int, err error) error
+	CaptureEnd(output []byte, gasUsed uint64, err error) error
+
+	// GetResult returns the tracer-specific result of the trace once
+	// execution has finished (or been stopped).
+	GetResult() (interface{}, error)
+
+	// Stop terminates execution of the active trace, surfacing err from
+	// CaptureState/CaptureFault's next call and from GetResult.
+	Stop(err error)
+}
+
+// ScopeContext is the stack/memory/contract state visible to a Tracer at
+// the point a single opcode is captured.
+type ScopeContext struct {
+	Stack    []*big.Int
+	Memory   []byte
+	Contract *ContractRef
+}
+
+// ContractRef is the minimal view of the currently executing contract a
+// Tracer needs: its own address and the storage slots it has touched.
+type ContractRef struct {
+	Address common.Address
+	Storage map[common.Hash]common.Hash
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/crypto"
+	"github.com/abt/zerium/rlp"
+)
+
+// rlpHash encodes val and returns its Keccak256 hash, the same scheme used
+// to hash headers and other RLP-serialisable chain objects.
+func rlpHash(val interface{}) (h common.Hash) {
+	enc, err := rlp.EncodeToBytes(val)
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// CheckpointOracleConfig represents a set of checkpoint contract(s) config
+// that is used to hold the signers and threshold information to verify the
+// checkpoint signed by the particular set of trusted signers.
+type CheckpointOracleConfig struct {
+	Address   common.Address   `json:"address"`
+	Signers   []common.Address `json:"signers"`
+	Threshold uint64           `json:"threshold"`
+}
+
+// TrustedCheckpoint represents a set of post-processed trie roots (CHT and
+// bloom trie) associated with the appropriate section index and head hash.
+// It is used to start light syncing from this checkpoint and avoid
+// downloading the entire header chain while still being able to access any
+// historical chain data via the trie roots.
+type TrustedCheckpoint struct {
+	SectionIndex uint64      `json:"sectionIndex"`
+	SectionHead  common.Hash `json:"sectionHead"`
+	CHTRoot      common.Hash `json:"chtRoot"`
+	BloomRoot    common.Hash `json:"bloomRoot"`
+}
+
+// HashEqual returns whether hash equals the checkpoint's own hash (see
+// Hash). An empty checkpoint only matches the zero hash.
+func (c *TrustedCheckpoint) HashEqual(hash common.Hash) bool {
+	if c.Empty() {
+		return hash == common.Hash{}
+	}
+	return c.Hash() == hash
+}
+
+// Hash returns the canonical hash of the checkpoint, combining its section
+// index, section head, CHT root and bloom root. Clients use this value,
+// rather than the individual fields, when comparing a checkpoint against a
+// signed oracle entry.
+func (c *TrustedCheckpoint) Hash() common.Hash {
+	return rlpHash([]interface{}{c.SectionIndex, c.SectionHead, c.CHTRoot, c.BloomRoot})
+}
+
+// Empty returns whether the checkpoint is empty.
+func (c *TrustedCheckpoint) Empty() bool {
+	return c.SectionHead == (common.Hash{}) || c.CHTRoot == (common.Hash{}) || c.BloomRoot == (common.Hash{})
+}
+
+// TrustedCheckpoints is the hardcoded, release-pinned fallback list of known
+// good checkpoints, keyed by section index, used when the checkpoint oracle
+// contract hasn't (yet) signed anything newer. Updated at release time as
+// new sections are confirmed safe.
+var TrustedCheckpoints = map[uint64]*TrustedCheckpoint{}
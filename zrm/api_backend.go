@@ -0,0 +1,82 @@
+// Copyright 2015 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"context"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/core/bloombits"
+	"github.com/abt/zerium/core/types"
+	"github.com/abt/zerium/params"
+	"github.com/abt/zerium/zrm/gasprice"
+)
+
+// EthApiBackend implements ethapi.Backend and filters.Backend for a full
+// Zerium node, answering RPC queries directly against the local chain and
+// chain database rather than over a network protocol (as les.LesApiBackend
+// does for light clients).
+type EthApiBackend struct {
+	zrm *Zerium
+	gpo *gasprice.Oracle
+}
+
+// HeaderByNumber returns the header at number, or the current head header
+// if number is negative.
+func (b *EthApiBackend) HeaderByNumber(ctx context.Context, number int64) (*types.Header, error) {
+	if number < 0 {
+		return b.zrm.blockchain.CurrentHeader(), nil
+	}
+	return b.zrm.blockchain.GetHeaderByNumber(uint64(number)), nil
+}
+
+// HeaderByHash returns the header identified by hash, or nil if unknown.
+func (b *EthApiBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.zrm.blockchain.GetHeaderByHash(hash), nil
+}
+
+// GetLogs returns the logs of every transaction included in the block
+// identified by hash, grouped by transaction in the same order they were
+// included.
+func (b *EthApiBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	receipts := b.zrm.blockchain.GetReceiptsByHash(hash)
+	if receipts == nil {
+		return nil, nil
+	}
+	logs := make([][]*types.Log, len(receipts))
+	for i, receipt := range receipts {
+		logs[i] = receipt.Logs
+	}
+	return logs, nil
+}
+
+// BloomStatus reports how many bloom-bits sections the chain's
+// ChainIndexer has finished processing, and the number of blocks per
+// section, so filters.Filter knows how far the indexed fast path reaches
+// before it has to fall back to scanning blocks directly.
+func (b *EthApiBackend) BloomStatus() (uint64, uint64) {
+	sections, _, _ := b.zrm.bloomIndexer.Sections()
+	return sections, params.BloomBitsBlocks
+}
+
+// ServiceFilter wires session's bit retrievals into this node's shared
+// bloomRequests channel, the same one Zerium.startBloomHandlers' pool of
+// goroutines services, so that concurrent filters coalesce their section
+// requests instead of each hitting the database independently.
+func (b *EthApiBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	session.Start(b.zrm.bloomRequests)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"errors"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/params"
+	"github.com/abt/zerium/zrm/checkpointoracle"
+)
+
+// errNoCheckpointOracle is returned when the checkpoint RPC methods are
+// called on a node that was started without a CheckpointOracle configured.
+var errNoCheckpointOracle = errors.New("checkpoint oracle not configured")
+
+// PublicCheckpointOracleAPI exposes read-only access to the checkpoint
+// oracle trust anchor used to bootstrap fast/snap sync from a recent,
+// signed checkpoint rather than genesis.
+type PublicCheckpointOracleAPI struct {
+	oracle *checkpointoracle.CheckpointOracle
+}
+
+// NewPublicCheckpointOracleAPI creates a new checkpoint oracle API. oracle
+// may be nil if the node wasn't configured with one, in which case every
+// method returns errNoCheckpointOracle.
+func NewPublicCheckpointOracleAPI(oracle *checkpointoracle.CheckpointOracle) *PublicCheckpointOracleAPI {
+	return &PublicCheckpointOracleAPI{oracle: oracle}
+}
+
+// GetCheckpoint returns the signed checkpoint at the requested section
+// index.
+func (api *PublicCheckpointOracleAPI) GetCheckpoint(index uint64) (*params.TrustedCheckpoint, error) {
+	if api.oracle == nil {
+		return nil, errNoCheckpointOracle
+	}
+	if cp := api.oracle.CheckpointInfo(index); cp != nil {
+		return cp, nil
+	}
+	return nil, errors.New("checkpoint not found")
+}
+
+// GetCheckpointContractAddress returns the address of the on-chain
+// checkpoint oracle contract this node trusts.
+func (api *PublicCheckpointOracleAPI) GetCheckpointContractAddress() (common.Address, error) {
+	if api.oracle == nil {
+		return common.Address{}, errNoCheckpointOracle
+	}
+	return api.oracle.ContractAddress().Address, nil
+}
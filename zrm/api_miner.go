@@ -0,0 +1,107 @@
+// Copyright 2015 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"math/big"
+
+	"github.com/abt/zerium/common/hexutil"
+	"github.com/abt/zerium/consensus/zrmash"
+)
+
+// PublicMinerAPI provides an API to control the miner that is safe to expose
+// publicly, without granting access to change any operational parameters.
+type PublicMinerAPI struct {
+	e *Zerium
+}
+
+// NewPublicMinerAPI creates a new miner API for the public RPC service.
+func NewPublicMinerAPI(e *Zerium) *PublicMinerAPI {
+	return &PublicMinerAPI{e}
+}
+
+// Mining returns whether this node is currently mining.
+func (api *PublicMinerAPI) Mining() bool {
+	return api.e.IsMining()
+}
+
+// GetHashrate returns the aggregate POW hashrate across this node's local
+// mining threads plus, when running zrmash, any remote work submitted
+// through the PoW RPC endpoint.
+func (api *PublicMinerAPI) GetHashrate() uint64 {
+	if en, ok := api.e.engine.(*zrmash.Ethash); ok {
+		return uint64(en.Hashrate())
+	}
+	return uint64(api.e.miner.HashRate())
+}
+
+// PrivateMinerAPI provides private RPC methods to control the miner. These
+// methods can be abused by external users and must be considered
+// insecure for use by untrusted users.
+type PrivateMinerAPI struct {
+	e *Zerium
+}
+
+// NewPrivateMinerAPI creates a new RPC service which controls the miner of
+// this node.
+func NewPrivateMinerAPI(e *Zerium) *PrivateMinerAPI {
+	return &PrivateMinerAPI{e: e}
+}
+
+// Start starts the miner with the given number of threads. If threads is
+// nil, the number of workers started is equal to the number of logical CPUs
+// that are usable by this process.
+func (api *PrivateMinerAPI) Start(threads *int) error {
+	if threads == nil {
+		return api.e.StartMining(true)
+	}
+	api.e.SetMinerThreads(*threads)
+	return api.e.StartMining(true)
+}
+
+// Stop terminates the miner, both at the consensus engine level as well as
+// at the block creation level.
+func (api *PrivateMinerAPI) Stop() {
+	api.e.StopMining()
+}
+
+// SetExtra sets the extra data a miner can include when miner blocks. This
+// is capped at params.MaximumExtraDataSize.
+func (api *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
+	if err := api.e.SetExtra([]byte(extra)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetGasPrice sets the minimum accepted gas price for the miner.
+func (api *PrivateMinerAPI) SetGasPrice(gasPrice hexutil.Big) bool {
+	api.e.SetGasPrice((*big.Int)(&gasPrice))
+	return true
+}
+
+// SetGasLimit sets the gaslimit to target towards during mining.
+func (api *PrivateMinerAPI) SetGasLimit(gasLimit hexutil.Uint64) bool {
+	api.e.SetGasLimit(uint64(gasLimit))
+	return true
+}
+
+// SetMinerThreads sets the number of threads the local CPU miner should use.
+func (api *PrivateMinerAPI) SetMinerThreads(threads int) bool {
+	api.e.SetMinerThreads(threads)
+	return true
+}
@@ -0,0 +1,339 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/core"
+	"github.com/abt/zerium/core/rawdb"
+	"github.com/abt/zerium/core/state"
+	"github.com/abt/zerium/core/types"
+	"github.com/abt/zerium/core/vm"
+	"github.com/abt/zerium/internal/ethapi"
+	"github.com/abt/zerium/params"
+	"github.com/abt/zerium/rpc"
+)
+
+const (
+	// defaultTraceTimeout is used if the TraceConfig does not specify one.
+	defaultTraceTimeout = 5 * time.Second
+
+	// defaultTraceReexec bounds how many ancestor blocks may be replayed to
+	// regenerate a pruned state before TraceTransaction gives up.
+	defaultTraceReexec = 128
+)
+
+// TraceConfig holds the tunables accepted by the debug_trace* RPC methods.
+type TraceConfig struct {
+	DisableMemory  bool
+	DisableStack   bool
+	DisableStorage bool
+	Tracer         *string // JavaScript snippet; defaults to the struct logger when nil
+	Timeout        *string
+	Reexec         *uint64
+}
+
+// PrivateDebugAPI exposes EVM tracing methods for a running Zerium node. It
+// is unauthenticated-unsafe (it can dump arbitrary contract storage and burn
+// CPU replaying blocks) and is therefore only ever registered as a private
+// API.
+type PrivateDebugAPI struct {
+	config *params.ChainConfig
+	zrm    *Zerium
+}
+
+// NewPrivateDebugAPI creates a new API definition for the tracing methods of
+// the Zerium service.
+func NewPrivateDebugAPI(config *params.ChainConfig, zrm *Zerium) *PrivateDebugAPI {
+	return &PrivateDebugAPI{config: config, zrm: zrm}
+}
+
+// txTraceResult is the result of a single transaction trace, returned as
+// part of a TraceBlockByNumber/TraceBlockByHash response.
+type txTraceResult struct {
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// TraceTransaction returns the structured logs created during the execution
+// of the given transaction, re-executed against the state of its parent
+// block.
+func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Hash, config *TraceConfig) (interface{}, error) {
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.zrm.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	block := api.zrm.blockchain.GetBlockByHash(blockHash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", blockHash)
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = int(*config.Reexec)
+	}
+	// traceTx replays transactions 0..index-1 itself, so it needs the state
+	// from immediately *before* the transaction's own block, not after it.
+	statedb, _, err := api.computeStateDB(ctx, block.ParentHash(), reexec)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceTx(ctx, block, statedb, int(index), config)
+}
+
+// TraceBlockByNumber replays every transaction in the block at number,
+// returning one trace result per transaction in order.
+func (api *PrivateDebugAPI) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]*txTraceResult, error) {
+	block := api.zrm.blockchain.GetBlockByNumber(uint64(number.Int64()))
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// TraceBlockByHash replays every transaction in the block identified by
+// hash, returning one trace result per transaction in order.
+func (api *PrivateDebugAPI) TraceBlockByHash(ctx context.Context, hash common.Hash, config *TraceConfig) ([]*txTraceResult, error) {
+	block := api.zrm.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// resolveBlockHash resolves blockNrOrHash to the hash of the block it
+// identifies, accepting either form an RPC caller may supply: an explicit
+// hash, or a block number/tag (mirroring EthApiBackend.HeaderByNumber's
+// negative-number-means-current-head handling).
+func (api *PrivateDebugAPI) resolveBlockHash(blockNrOrHash rpc.BlockNumberOrHash) (common.Hash, error) {
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		return hash, nil
+	}
+	number, ok := blockNrOrHash.Number()
+	if !ok {
+		return common.Hash{}, errors.New("TraceCall requires a block hash or number")
+	}
+	var header *types.Header
+	if number.Int64() < 0 {
+		header = api.zrm.blockchain.CurrentHeader()
+	} else {
+		header = api.zrm.blockchain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("block #%d not found", number)
+	}
+	return header.Hash(), nil
+}
+
+// TraceCall traces the execution of a message against the state at
+// blockNrOrHash without requiring it to correspond to an actual mined
+// transaction, useful for previewing a call before sending it.
+func (api *PrivateDebugAPI) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceConfig) (interface{}, error) {
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = int(*config.Reexec)
+	}
+	hash, err := api.resolveBlockHash(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	statedb, block, err := api.computeStateDB(ctx, hash, reexec)
+	if err != nil {
+		return nil, err
+	}
+	msg, vmctx, err := ethapi.NewCallMessage(ctx, api.zrm.ApiBackend, args, block.Header())
+	if err != nil {
+		return nil, err
+	}
+	tracer, timeout, err := api.makeTracer(config)
+	if err != nil {
+		return nil, err
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	go func() {
+		<-timeoutCtx.Done()
+		tracer.Stop(errors.New("execution timeout"))
+	}()
+
+	vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{Debug: true, Tracer: tracer})
+	if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	return tracer.GetResult()
+}
+
+// traceBlock re-executes every transaction in block against its parent
+// state, collecting one result per transaction.
+func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block, config *TraceConfig) ([]*txTraceResult, error) {
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = int(*config.Reexec)
+	}
+	statedb, _, err := api.computeStateDB(ctx, block.ParentHash(), reexec)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*txTraceResult, len(block.Transactions()))
+	for i := range block.Transactions() {
+		// traceTx replays transactions 0..i-1 itself, so every call starts
+		// from its own copy of the parent state.
+		res, err := api.traceTx(ctx, block, statedb.Copy(), i, config)
+		if err != nil {
+			results[i] = &txTraceResult{Error: err.Error()}
+			continue
+		}
+		results[i] = &txTraceResult{Result: res}
+	}
+	return results, nil
+}
+
+// traceTx executes the txIndex'th transaction of block against statedb
+// (which must reflect the state before the block's first transaction;
+// transactions 0..txIndex-1 are replayed here first) and returns the
+// configured tracer's result. statedb is modified in place.
+func (api *PrivateDebugAPI) traceTx(ctx context.Context, block *types.Block, statedb *state.StateDB, txIndex int, config *TraceConfig) (interface{}, error) {
+	txs := block.Transactions()
+	if txIndex < 0 || txIndex >= len(txs) {
+		return nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, block.Hash())
+	}
+	tracer, timeout, err := api.makeTracer(config)
+	if err != nil {
+		return nil, err
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	go func() {
+		<-timeoutCtx.Done()
+		tracer.Stop(errors.New("execution timeout"))
+	}()
+
+	signer := types.MakeSigner(api.config, block.Number())
+	for i, tx := range txs {
+		msg, _ := tx.AsMessage(signer)
+		vmctx := core.NewEVMContext(msg, block.Header(), api.zrm.blockchain, nil)
+		if i == txIndex {
+			vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{Debug: true, Tracer: tracer})
+			if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				return nil, fmt.Errorf("tracing failed: %v", err)
+			}
+			return tracer.GetResult()
+		}
+		// Transactions before txIndex only need to be replayed to advance
+		// statedb to the right point; their own tracer output is discarded.
+		vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{})
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			return nil, fmt.Errorf("tracing failed for predecessor transaction: %v", err)
+		}
+		statedb.Finalise(true)
+	}
+	return nil, fmt.Errorf("transaction index %d out of range", txIndex)
+}
+
+// makeTracer builds the vm.Tracer requested by config: the default
+// opcode-level struct logger, or, when config.Tracer is set, the result of
+// vm.NewJSTracer. NewJSTracer always returns an error in this build, so a
+// config that sets Tracer gets an "invalid tracer" error and no trace.
+func (api *PrivateDebugAPI) makeTracer(config *TraceConfig) (vm.Tracer, time.Duration, error) {
+	timeout := defaultTraceTimeout
+	if config != nil && config.Timeout != nil {
+		d, err := time.ParseDuration(*config.Timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		timeout = d
+	}
+	if config != nil && config.Tracer != nil {
+		tracer, err := vm.NewJSTracer(*config.Tracer)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid tracer: %v", err)
+		}
+		return tracer, timeout, nil
+	}
+	logConfig := vm.LogConfig{}
+	if config != nil {
+		logConfig.DisableMemory = config.DisableMemory
+		logConfig.DisableStack = config.DisableStack
+		logConfig.DisableStorage = config.DisableStorage
+	}
+	return vm.NewStructLogger(&logConfig), timeout, nil
+}
+
+// computeStateDB returns the state immediately after the block identified by
+// hash, replaying up to reexec ancestor blocks if that state isn't already
+// materialised on disk (e.g. because of trie pruning).
+func (api *PrivateDebugAPI) computeStateDB(ctx context.Context, hash common.Hash, reexec int) (*state.StateDB, *types.Block, error) {
+	block := api.zrm.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, nil, fmt.Errorf("block %#x not found", hash)
+	}
+	if statedb, err := api.zrm.blockchain.StateAt(block.Root()); err == nil {
+		return statedb, block, nil
+	}
+	// State isn't available directly; walk back to the nearest ancestor
+	// that still has one, then replay every block back down to the target,
+	// applying each transaction in turn to advance the state.
+	var (
+		statedb   *state.StateDB
+		ancestors = []*types.Block{block}
+		current   = block
+	)
+	for i := 0; i < reexec; i++ {
+		parent := api.zrm.blockchain.GetBlockByHash(current.ParentHash())
+		if parent == nil {
+			break
+		}
+		if db, err := api.zrm.blockchain.StateAt(parent.Root()); err == nil {
+			statedb = db
+			break
+		}
+		ancestors = append(ancestors, parent)
+		current = parent
+	}
+	if statedb == nil {
+		return nil, nil, fmt.Errorf("historical state not available within %d blocks of reexec", reexec)
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		b := ancestors[i]
+		signer := types.MakeSigner(api.config, b.Number())
+		for _, tx := range b.Transactions() {
+			msg, err := tx.AsMessage(signer)
+			if err != nil {
+				return nil, nil, err
+			}
+			vmctx := core.NewEVMContext(msg, b.Header(), api.zrm.blockchain, nil)
+			vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{})
+			if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				return nil, nil, fmt.Errorf("replaying block %#x: %v", b.Hash(), err)
+			}
+			statedb.Finalise(true)
+		}
+		// Apply block/uncle rewards the same way full block processing
+		// would, so a trace reading a miner's balance during a later
+		// transaction sees the same state the chain actually has, not one
+		// missing every replayed block's reward.
+		api.zrm.engine.Finalize(api.zrm.blockchain, b.Header(), statedb, b.Transactions(), b.Uncles())
+	}
+	return statedb, block, nil
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/abt/zerium/core/bloombits"
 	"github.com/abt/zerium/core/types"
 	"github.com/abt/zerium/core/vm"
+	"github.com/abt/zerium/zrm/checkpointoracle"
 	"github.com/abt/zerium/zrm/downloader"
 	"github.com/abt/zerium/zrm/filters"
 	"github.com/abt/zerium/zrm/gasprice"
@@ -82,6 +83,8 @@ type Zerium struct {
 	bloomRequests chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer  *core.ChainIndexer             // Bloom indexer operating during block imports
 
+	checkpointOracle *checkpointoracle.CheckpointOracle // Trust anchor for fast/snap sync pivots, nil if unconfigured
+
 	ApiBackend *EthApiBackend
 
 	miner     *miner.Miner
@@ -108,6 +111,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Zerium, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	// SnapSync passes the check above, but nothing in this package creates a
+	// downloader.SnapSyncer for it, and snap/1 is not among the protocols
+	// returned by Protocols; the mode is handed to NewProtocolManager as is.
 	chainDb, err := CreateDB(ctx, config, "chaindata")
 	if err != nil {
 		return nil, err
@@ -119,13 +125,18 @@ func New(ctx *node.ServiceContext, config *Config) (*Zerium, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	engine, err := CreateConsensusEngine(ctx, config, chainConfig, chainDb)
+	if err != nil {
+		return nil, err
+	}
+
 	zrm := &Zerium{
 		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
 		eventMux:       ctx.EventMux,
 		accountManager: ctx.AccountManager,
-		engine:         CreateConsensusEngine(ctx, config, chainConfig, chainDb),
+		engine:         engine,
 		shutdownChan:   make(chan bool),
 		stopDbUpgrade:  stopDbUpgrade,
 		networkId:      config.NetworkId,
@@ -145,8 +156,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Zerium, error) {
 		core.WriteBlockChainVersion(chainDb, core.BlockChainVersion)
 	}
 
+	cacheConfig := &core.CacheConfig{TrieCleanLimit: config.TrieCleanCache}
 	vmConfig := vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-	zrm.blockchain, err = core.NewBlockChain(chainDb, zrm.chainConfig, zrm.engine, vmConfig)
+	zrm.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, zrm.chainConfig, zrm.engine, vmConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +175,15 @@ func New(ctx *node.ServiceContext, config *Config) (*Zerium, error) {
 	}
 	zrm.txPool = core.NewTxPool(config.TxPool, zrm.chainConfig, zrm.blockchain)
 
-	if zrm.protocolManager, err = NewProtocolManager(zrm.chainConfig, config.SyncMode, config.NetworkId, zrm.eventMux, zrm.txPool, zrm.engine, zrm.blockchain, chainDb); err != nil {
+	// Build the checkpoint oracle before the protocol manager so its latest
+	// trusted checkpoint (if any) can be handed to the downloader as the
+	// fast/snap sync pivot, instead of letting sync fall back to trusting
+	// whichever peer answers first.
+	if config.CheckpointOracle != nil {
+		zrm.checkpointOracle = checkpointoracle.New(config.CheckpointOracle, params.TrustedCheckpoints, &ethContractReader{zrm})
+	}
+
+	if zrm.protocolManager, err = NewProtocolManager(zrm.chainConfig, config.SyncMode, config.NetworkId, zrm.eventMux, zrm.txPool, zrm.engine, zrm.blockchain, chainDb, zrm.checkpointOracle); err != nil {
 		return nil, err
 	}
 	zrm.miner = miner.New(zrm, zrm.chainConfig, zrm.EventMux(), zrm.engine)
@@ -208,29 +228,81 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (zrmdb.Data
 	return db, nil
 }
 
-// CreateConsensusEngine creates the required type of consensus engine instance for an Zerium service
-func CreateConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db zrmdb.Database) consensus.Engine {
-	// If proof-of-authority is requested, set it up
-	if chainConfig.Clique != nil {
-		return clique.New(chainConfig.Clique, db)
-	}
-	// Otherwise assume proof-of-work
-	switch {
-	case config.PowFake:
-		log.Warn("Ethash used in fake mode")
-		return zrmash.NewFaker()
-	case config.PowTest:
-		log.Warn("Ethash used in test mode")
-		return zrmash.NewTester()
-	case config.PowShared:
-		log.Warn("Ethash used in shared mode")
-		return zrmash.NewShared()
-	default:
-		engine := zrmash.New(ctx.ResolvePath(config.EthashCacheDir), config.EthashCachesInMem, config.EthashCachesOnDisk,
-			config.EthashDatasetDir, config.EthashDatasetsInMem, config.EthashDatasetsOnDisk)
-		engine.SetThreads(-1) // Disable CPU mining
-		return engine
+// EngineFactory builds a consensus.Engine for chainCfg/cfg. Packages outside
+// zrm register one under a name with RegisterEngine so that downstream forks
+// can plug in alternative PoA/PoS/BFT engines without patching zrm itself.
+type EngineFactory func(ctx *node.ServiceContext, cfg *Config, chainCfg *params.ChainConfig, db zrmdb.Database) (consensus.Engine, error)
+
+var (
+	engineRegistryMu sync.RWMutex
+	engineRegistry   = make(map[string]EngineFactory)
+)
+
+// RegisterEngine makes a consensus engine factory selectable by name through
+// Config.Engine / chainConfig. It is meant to be called from an init() in
+// the engine's own package, before node.New constructs the Zerium service.
+// RegisterEngine panics if name is already registered, mirroring the
+// database/sql driver registration pattern.
+func RegisterEngine(name string, factory EngineFactory) {
+	if factory == nil {
+		panic("zrm: RegisterEngine factory is nil")
+	}
+	engineRegistryMu.Lock()
+	defer engineRegistryMu.Unlock()
+	if _, dup := engineRegistry[name]; dup {
+		panic("zrm: RegisterEngine called twice for engine " + name)
 	}
+	engineRegistry[name] = factory
+}
+
+func init() {
+	RegisterEngine("clique", func(ctx *node.ServiceContext, cfg *Config, chainCfg *params.ChainConfig, db zrmdb.Database) (consensus.Engine, error) {
+		if chainCfg.Clique == nil {
+			return nil, errors.New("clique engine selected but chain config has no clique settings")
+		}
+		return clique.New(chainCfg.Clique, db), nil
+	})
+	RegisterEngine("zrmash", func(ctx *node.ServiceContext, cfg *Config, chainCfg *params.ChainConfig, db zrmdb.Database) (consensus.Engine, error) {
+		switch {
+		case cfg.PowFake:
+			log.Warn("Ethash used in fake mode")
+			return zrmash.NewFaker(), nil
+		case cfg.PowTest:
+			log.Warn("Ethash used in test mode")
+			return zrmash.NewTester(), nil
+		case cfg.PowShared:
+			log.Warn("Ethash used in shared mode")
+			return zrmash.NewShared(), nil
+		default:
+			engine := zrmash.New(ctx.ResolvePath(cfg.EthashCacheDir), cfg.EthashCachesInMem, cfg.EthashCachesOnDisk,
+				cfg.EthashDatasetDir, cfg.EthashDatasetsInMem, cfg.EthashDatasetsOnDisk)
+			engine.SetThreads(-1) // Disable CPU mining
+			return engine, nil
+		}
+	})
+}
+
+// CreateConsensusEngine creates the required type of consensus engine
+// instance for a Zerium service. If config.Engine names a registered engine,
+// that one is used; otherwise the engine is auto-detected the way it always
+// was, for compatibility with existing genesis/config files: clique when
+// chainConfig.Clique is set, zrmash otherwise.
+func CreateConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig *params.ChainConfig, db zrmdb.Database) (consensus.Engine, error) {
+	name := config.Engine
+	if name == "" {
+		if chainConfig.Clique != nil {
+			name = "clique"
+		} else {
+			name = "zrmash"
+		}
+	}
+	engineRegistryMu.RLock()
+	factory, ok := engineRegistry[name]
+	engineRegistryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown consensus engine %q", name)
+	}
+	return factory(ctx, config, chainConfig, db)
 }
 
 // APIs returns the collection of RPC services the abt package offers.
@@ -286,6 +358,11 @@ func (s *Zerium) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   s.netRPCService,
 			Public:    true,
+		}, {
+			Namespace: "zrm",
+			Version:   "1.0",
+			Service:   NewPublicCheckpointOracleAPI(s.checkpointOracle),
+			Public:    true,
 		},
 	}...)
 }
@@ -348,6 +425,49 @@ func (s *Zerium) StopMining()         { s.miner.Stop() }
 func (s *Zerium) IsMining() bool      { return s.miner.Mining() }
 func (s *Zerium) Miner() *miner.Miner { return s.miner }
 
+// SetMinerThreads sets the number of local CPU mining threads, taking effect
+// for the next mining round without requiring a restart.
+func (s *Zerium) SetMinerThreads(threads int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.config.MinerThreads = threads
+	s.miner.SetThreads(threads)
+}
+
+// SetExtra sets the extra data field the miner stamps into blocks it mines.
+func (s *Zerium) SetExtra(extra []byte) error {
+	if uint64(len(extra)) > params.MaximumExtraDataSize {
+		return fmt.Errorf("extra exceeds max length. %d > %v", len(extra), params.MaximumExtraDataSize)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.config.ExtraData = extra
+	s.miner.SetExtra(extra)
+	return nil
+}
+
+// SetGasPrice sets the minimum gas price the transaction pool accepts and
+// the miner requires of transactions it includes.
+func (s *Zerium) SetGasPrice(gasPrice *big.Int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.config.GasPrice = gasPrice
+	s.gasPrice = gasPrice
+	s.txPool.SetGasPrice(gasPrice)
+}
+
+// SetGasLimit sets the gas ceiling the miner targets when building the next
+// block.
+func (s *Zerium) SetGasLimit(gasLimit uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.miner.SetGasCeil(gasLimit)
+}
+
 func (s *Zerium) AccountManager() *accounts.Manager  { return s.accountManager }
 func (s *Zerium) BlockChain() *core.BlockChain       { return s.blockchain }
 func (s *Zerium) TxPool() *core.TxPool               { return s.txPool }
@@ -362,6 +482,8 @@ func (s *Zerium) Downloader() *downloader.Downloader { return s.protocolManager.
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *Zerium) Protocols() []p2p.Protocol {
+	// snap/1 (see protocol_snap.go) isn't registered here yet: there's no
+	// ProtocolManager handler for it to dispatch to.
 	if s.lesServer == nil {
 		return s.protocolManager.SubProtocols
 	}
@@ -374,6 +496,12 @@ func (s *Zerium) Start(srvr *p2p.Server) error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers()
 
+	// Start polling the checkpoint oracle contract for newer signed
+	// checkpoints, if one is configured.
+	if s.checkpointOracle != nil {
+		s.checkpointOracle.Start()
+	}
+
 	// Start the RPC service
 	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.NetVersion())
 
@@ -400,6 +528,9 @@ func (s *Zerium) Stop() error {
 		s.stopDbUpgrade()
 	}
 	s.bloomIndexer.Close()
+	if s.checkpointOracle != nil {
+		s.checkpointOracle.Stop()
+	}
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
 	if s.lesServer != nil {
@@ -0,0 +1,151 @@
+// Copyright 2017 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"context"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/common/bitutil"
+	"github.com/abt/zerium/core"
+	"github.com/abt/zerium/core/bloombits"
+	"github.com/abt/zerium/core/rawdb"
+	"github.com/abt/zerium/core/types"
+	"github.com/abt/zerium/params"
+	"github.com/abt/zerium/zrmdb"
+)
+
+const (
+	// bloomServiceThreads is the number of goroutines used globally by an Zerium
+	// instance to service bloombits lookups for all running filters.
+	bloomServiceThreads = 16
+
+	// bloomFilterThreads is not used: filters run no multiplexing goroutines
+	// of their own, and each bloombits.MatcherSession submits its retrievals
+	// on bloomRequests directly (see EthApiBackend.ServiceFilter).
+	bloomFilterThreads = 3
+
+	// bloomRetrievalBatch is not used: retrievals are neither batched nor
+	// capped, each one covering one bit and the sections of a single
+	// scheduler call.
+	bloomRetrievalBatch = 16
+)
+
+// startBloomHandlers starts a batch of goroutines to accept bloom bit
+// database retrievals from possibly a range of filters and serve them to the
+// requesters. They are deliberately shared across filters to force the
+// requests to coalesce, disregarding the single filter's own rate limits and
+// letting multiple subscribers' section requests batch together.
+func (zrm *Zerium) startBloomHandlers() {
+	for i := 0; i < bloomServiceThreads; i++ {
+		go func() {
+			for {
+				select {
+				case <-zrm.shutdownChan:
+					return
+
+				case request := <-zrm.bloomRequests:
+					task := <-request
+					task.Bitsets = make([][]byte, len(task.Sections))
+					for i, section := range task.Sections {
+						head := rawdb.ReadCanonicalHash(zrm.chainDb, (section+1)*params.BloomBitsBlocks-1)
+						if compVector, err := rawdb.ReadBloomBits(zrm.chainDb, task.Bit, section, head); err == nil {
+							if blob, err := bitutil.DecompressBytes(compVector, int(params.BloomBitsBlocks)/8); err == nil {
+								task.Bitsets[i] = blob
+							} else {
+								task.Error = err
+							}
+						} else {
+							task.Error = err
+						}
+					}
+					request <- task
+				}
+			}
+		}()
+	}
+}
+
+const (
+	// bloomConfirms is the number of confirmation blocks before a bloom section
+	// is considered probably final and its rotated bits are calculated.
+	bloomConfirms = 256
+
+	// bloomThrottling is the time to wait between processing two consecutive
+	// index sections, it's a way to control the indexer's resource usage.
+	bloomThrottling = 100
+)
+
+// BloomIndexer implements core.ChainIndexerBackend, building up a rotated
+// bloom bits index for the Ethereum header bloom filters, permitting
+// blazing fast filtering.
+type BloomIndexer struct {
+	size uint64 // Section size of the bloom filter index
+
+	db  zrmdb.Database      // Database containing the index
+	gen *bloombits.Generator // Generator to rotate the bloom bits crating the bloom index
+
+	section uint64      // Section being processed currently
+	head    common.Hash // Head header's hash of the section being processed
+}
+
+// NewBloomIndexer returns a chain indexer that generates bloom bits data for
+// the canonical chain for fast logs filtering.
+func NewBloomIndexer(db zrmdb.Database, size uint64) *core.ChainIndexer {
+	backend := &BloomIndexer{
+		db:   db,
+		size: size,
+	}
+	table := rawdb.NewTable(db, string(rawdb.BloomBitsIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, size, bloomConfirms, bloomThrottling, "bloombits")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new bloombits index
+// section.
+func (b *BloomIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	gen, err := bloombits.NewGenerator(uint(b.size))
+	if err != nil {
+		return err
+	}
+	b.gen, b.section, b.head = gen, section, common.Hash{}
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding a new header's bloom
+// into the index.
+func (b *BloomIndexer) Process(ctx context.Context, header *types.Header) error {
+	if err := b.gen.AddBloom(uint(header.Number.Uint64()-b.section*b.size), header.Bloom); err != nil {
+		return err
+	}
+	b.head = header.Hash()
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, finalizing the bloom section
+// and writing it out to the database.
+func (b *BloomIndexer) Commit() error {
+	batch := b.db.NewBatch()
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, err := b.gen.Bitset(uint(i))
+		if err != nil {
+			return err
+		}
+		rawdb.WriteBloomBits(batch, uint(i), b.section, b.head, bitutil.CompressBytes(bits))
+	}
+	return batch.Write()
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/abt/zerium/params"
+)
+
+// ethContractReader implements checkpointoracle.ContractReader against this
+// node's own chain state, the way a full node (as opposed to a light
+// client dialing out over LES) is expected to read the oracle contract:
+// directly, without a network round trip.
+//
+// Doing that for real means packing the getter call and unpacking its
+// return data against the contract's ABI, the way a go-ethereum fork
+// generates with abigen into contracts/checkpointoracle. This tree has
+// neither an abi package nor a generated binding, so CheckpointEvent
+// reports that plainly instead of guessing at a wire format - the polling
+// loop in checkpointoracle.CheckpointOracle.Start is still real and still
+// runs on schedule, and starts working the moment a binding is wired in
+// here.
+type ethContractReader struct {
+	zrm *Zerium
+}
+
+// CheckpointEvent implements checkpointoracle.ContractReader.
+func (r *ethContractReader) CheckpointEvent(ctx context.Context) (*params.TrustedCheckpoint, [][]byte, error) {
+	return nil, nil, errors.New("zrm: checkpoint oracle contract binding not available in this build")
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package checkpointoracle implements a client for the checkpoint oracle
+// contract, a small trust anchor that lets fast/snap syncing nodes start
+// from a recent, signed (section, CHT root, bloom root) tuple instead of
+// genesis, without having to trust whichever peer happens to serve the
+// pivot header.
+package checkpointoracle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/crypto"
+	"github.com/abt/zerium/log"
+	"github.com/abt/zerium/params"
+)
+
+// pollInterval is how often Start checks the oracle contract for a newer
+// signed checkpoint. Sections only advance once every CHTFrequency worth of
+// blocks (on the order of hours), so there's no benefit to polling tighter
+// than this.
+const pollInterval = 1 * time.Hour
+
+// ContractReader fetches the most recently signed checkpoint announcement
+// from the oracle contract, along with the raw signatures attached to it.
+// zrm/checkpoint_reader.go supplies the implementation a full node uses,
+// which has no contract binding and returns an error on every call; it is
+// abstracted out here so the oracle's polling and verification logic can be
+// exercised without one.
+type ContractReader interface {
+	CheckpointEvent(ctx context.Context) (checkpoint *params.TrustedCheckpoint, signatures [][]byte, err error)
+}
+
+// CheckpointOracle periodically reads signed checkpoint announcements
+// (either from the on-chain contract named in its config, or from a
+// hardcoded fallback list shipped in params) and exposes the most recent
+// one a caller has accepted so far.
+type CheckpointOracle struct {
+	config   *params.CheckpointOracleConfig
+	fallback map[uint64]*params.TrustedCheckpoint // Hardcoded checkpoints, keyed by section index
+	reader   ContractReader                       // nil if no on-chain reader is wired in; fallback-only
+
+	lock   sync.RWMutex
+	latest *params.TrustedCheckpoint
+
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates a checkpoint oracle client. fallback supplies the hardcoded
+// checkpoint list to fall back to when the on-chain contract has not yet
+// signed anything newer; it may be empty for private/test networks. reader
+// may be nil, in which case Start only ever serves the fallback list.
+func New(config *params.CheckpointOracleConfig, fallback map[uint64]*params.TrustedCheckpoint, reader ContractReader) *CheckpointOracle {
+	return &CheckpointOracle{
+		config:   config,
+		fallback: fallback,
+		reader:   reader,
+	}
+}
+
+// Start launches the background loop that polls reader for newly signed
+// checkpoints and, once one passes verify, installs it as latest. It is a
+// no-op if no reader was supplied to New.
+func (oracle *CheckpointOracle) Start() {
+	if oracle.reader == nil {
+		return
+	}
+	oracle.closeCh = make(chan struct{})
+	oracle.wg.Add(1)
+	go oracle.loop()
+}
+
+// Stop terminates the polling loop started by Start and waits for it to
+// exit. It is a no-op if Start was never called.
+func (oracle *CheckpointOracle) Stop() {
+	if oracle.closeCh == nil {
+		return
+	}
+	close(oracle.closeCh)
+	oracle.wg.Wait()
+}
+
+func (oracle *CheckpointOracle) loop() {
+	defer oracle.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		oracle.poll()
+		select {
+		case <-ticker.C:
+		case <-oracle.closeCh:
+			return
+		}
+	}
+}
+
+func (oracle *CheckpointOracle) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), pollInterval)
+	defer cancel()
+
+	cp, sigs, err := oracle.reader.CheckpointEvent(ctx)
+	if err != nil {
+		log.Warn("Failed to read checkpoint oracle contract", "err", err)
+		return
+	}
+	if cp == nil || cp.Empty() {
+		return
+	}
+	if !oracle.verify(cp, sigs) {
+		log.Warn("Dropping checkpoint with insufficient valid signatures", "section", cp.SectionIndex)
+		return
+	}
+	oracle.UpdateCheckpoint(cp)
+}
+
+// verify reports whether at least config.Threshold distinct addresses in
+// config.Signers signed cp's hash.
+func (oracle *CheckpointOracle) verify(cp *params.TrustedCheckpoint, sigs [][]byte) bool {
+	allowed := make(map[common.Address]bool, len(oracle.config.Signers))
+	for _, signer := range oracle.config.Signers {
+		allowed[signer] = true
+	}
+	hash := cp.Hash()
+	seen := make(map[common.Address]bool)
+	for _, sig := range sigs {
+		pubkey, err := crypto.SigToPub(hash.Bytes(), sig)
+		if err != nil {
+			continue
+		}
+		addr := crypto.PubkeyToAddress(*pubkey)
+		if allowed[addr] {
+			seen[addr] = true
+		}
+	}
+	return uint64(len(seen)) >= oracle.config.Threshold
+}
+
+// CheckpointInfo returns the trusted checkpoint at the given section index,
+// or nil if none is known yet.
+func (oracle *CheckpointOracle) CheckpointInfo(index uint64) *params.TrustedCheckpoint {
+	oracle.lock.RLock()
+	defer oracle.lock.RUnlock()
+
+	if oracle.latest != nil && oracle.latest.SectionIndex == index {
+		return oracle.latest
+	}
+	return oracle.fallback[index]
+}
+
+// LatestCheckpoint returns the most recent checkpoint this oracle has
+// accepted, whether observed on-chain or taken from the fallback list.
+func (oracle *CheckpointOracle) LatestCheckpoint() *params.TrustedCheckpoint {
+	oracle.lock.RLock()
+	defer oracle.lock.RUnlock()
+
+	if oracle.latest != nil {
+		return oracle.latest
+	}
+	var best *params.TrustedCheckpoint
+	for _, cp := range oracle.fallback {
+		if best == nil || cp.SectionIndex > best.SectionIndex {
+			best = cp
+		}
+	}
+	return best
+}
+
+// UpdateCheckpoint records cp, already verified against config's signer
+// set/threshold by poll, as the new latest trust anchor. It is also exported
+// directly so callers with their own verified source of checkpoints (tests,
+// or a light client syncing from a different transport) don't need to run
+// the polling loop to install one. It is a no-op if cp is not newer than
+// what's already known.
+func (oracle *CheckpointOracle) UpdateCheckpoint(cp *params.TrustedCheckpoint) {
+	oracle.lock.Lock()
+	defer oracle.lock.Unlock()
+
+	if oracle.latest != nil && cp.SectionIndex <= oracle.latest.SectionIndex {
+		return
+	}
+	oracle.latest = cp
+}
+
+// ContractAddress returns the config of the checkpoint oracle this client
+// is watching; its Address field is the on-chain contract's address.
+func (oracle *CheckpointOracle) ContractAddress() params.CheckpointOracleConfig {
+	return *oracle.config
+}
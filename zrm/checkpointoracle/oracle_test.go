@@ -0,0 +1,79 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package checkpointoracle
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/crypto"
+	"github.com/abt/zerium/params"
+)
+
+func TestVerifyThreshold(t *testing.T) {
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	stranger, _ := crypto.GenerateKey()
+
+	config := &params.CheckpointOracleConfig{
+		Signers:   []common.Address{crypto.PubkeyToAddress(key1.PublicKey), crypto.PubkeyToAddress(key2.PublicKey)},
+		Threshold: 2,
+	}
+	oracle := New(config, nil, nil)
+
+	cp := &params.TrustedCheckpoint{SectionIndex: 1, SectionHead: common.Hash{1}, CHTRoot: common.Hash{2}, BloomRoot: common.Hash{3}}
+	hash := cp.Hash()
+
+	sign := func(key *ecdsa.PrivateKey) []byte {
+		sig, err := crypto.Sign(hash.Bytes(), key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return sig
+	}
+
+	// Below threshold: only one valid signer.
+	if oracle.verify(cp, [][]byte{sign(key1)}) {
+		t.Fatal("verify() = true with only 1 of 2 required signatures")
+	}
+	// At threshold: both configured signers.
+	if !oracle.verify(cp, [][]byte{sign(key1), sign(key2)}) {
+		t.Fatal("verify() = false with both required signatures present")
+	}
+	// A signature from someone not in the signer set doesn't count towards
+	// the threshold, even alongside one valid signature.
+	if oracle.verify(cp, [][]byte{sign(key1), sign(stranger)}) {
+		t.Fatal("verify() = true counting a non-signer's signature")
+	}
+}
+
+func TestUpdateCheckpointOnlyAdvances(t *testing.T) {
+	oracle := New(&params.CheckpointOracleConfig{}, nil, nil)
+
+	first := &params.TrustedCheckpoint{SectionIndex: 1, SectionHead: common.Hash{1}, CHTRoot: common.Hash{1}, BloomRoot: common.Hash{1}}
+	oracle.UpdateCheckpoint(first)
+	if got := oracle.LatestCheckpoint(); got != first {
+		t.Fatalf("LatestCheckpoint() = %v, want %v", got, first)
+	}
+
+	older := &params.TrustedCheckpoint{SectionIndex: 0, SectionHead: common.Hash{2}, CHTRoot: common.Hash{2}, BloomRoot: common.Hash{2}}
+	oracle.UpdateCheckpoint(older)
+	if got := oracle.LatestCheckpoint(); got != first {
+		t.Fatalf("UpdateCheckpoint() replaced newer checkpoint with an older one: got %v, want %v", got, first)
+	}
+}
@@ -42,6 +42,7 @@ var DefaultConfig = Config{
 	NetworkId:            1,
 	LightPeers:           20,
 	DatabaseCache:        128,
+	TrieCleanCache:       256,
 	GasPrice:             big.NewInt(18 * params.Shannon),
 
 	TxPool: core.DefaultTxPoolConfig,
@@ -76,6 +77,16 @@ type Config struct {
 	NetworkId uint64 // Network ID to use for selecting peers to connect to
 	SyncMode  downloader.SyncMode
 
+	// Engine selects a registered consensus engine by name (see
+	// zrm.RegisterEngine). Leave empty to auto-detect clique/zrmash from the
+	// chain config, as before.
+	Engine string `toml:",omitempty"`
+
+	// CheckpointOracle contains the checkpoint oracle contract address and
+	// trusted signer set used to validate fast/snap sync pivots without
+	// having to trust the serving peer. Leave nil to sync from genesis.
+	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -85,6 +96,11 @@ type Config struct {
 	DatabaseHandles    int  `toml:"-"`
 	DatabaseCache      int
 
+	// TrieCleanCache is the memory allowance, in MiB, for the state trie's
+	// clean-node cache (see core.CacheConfig.TrieCleanLimit). It is never
+	// persisted to disk between restarts.
+	TrieCleanCache int
+
 	// Mining-related options
 	Etherbase    common.Address `toml:",omitempty"`
 	MinerThreads int            `toml:",omitempty"`
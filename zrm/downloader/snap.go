@@ -0,0 +1,237 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/abt/zerium/common"
+)
+
+// maxRangeHash is the largest possible trie key, used as the upper bound of
+// the very first range task so the initial partition spans the entire key
+// space.
+var maxRangeHash = common.HexToHash("0x" + strings.Repeat("f", 64))
+
+// maxSnapRangeRetries bounds how many times a range is reassigned to a new
+// peer before Retry stops halving it any further and just requeues it
+// as-is, to avoid partitioning a consistently-unavailable range down to
+// single keys.
+const maxSnapRangeRetries = 8
+
+// SnapSyncer keeps the range bookkeeping of the SnapSync algorithm: it
+// partitions the flat account and storage key space into contiguous ranges,
+// hands them out through AssignTask, splits ranges that keep failing in
+// Retry, and queues the trie node paths to fetch in the healing phase. It
+// does not itself request ranges from peers, verify range proofs, write
+// leaves or diff the trie against the target root: the caller does that,
+// reports each range back through MarkDone or Retry, and supplies the fetch
+// callback for Heal.
+//
+// tasks and healQueue are kept in memory only - restarting the node loses
+// all progress and restarts the whole key space from scratch. Making that
+// resumable means persisting both across restarts keyed by root, the way
+// upstream Zerium does via its own snapshot-journal entries in the chain
+// database; this tree has no ethdb/rawdb KV layer for SnapSyncer to write
+// that journal through (see protocol_snap.go for the same gap one layer
+// up: there's no ProtocolManager handler to drive this syncer with real
+// peers yet either). Wire in checkpointing of tasks/healQueue here once a
+// database handle is available to persist them through.
+type SnapSyncer struct {
+	root common.Hash // State root the syncer is trying to fill in
+
+	tasks     []*snapRangeTask  // Pending account/storage ranges, awaiting assignment to a peer
+	healQueue []TrieNodePathSet // Trie node paths known missing once every range has been filled in
+}
+
+// snapRangeTask is a single contiguous slice of the key space that still
+// needs to be requested from a peer and verified against root.
+type snapRangeTask struct {
+	next common.Hash // First key still owed in this range
+	last common.Hash // Last key covered by this range
+
+	retries int // Number of times this range has been reassigned after a failed/invalid response
+}
+
+// NewSnapSyncer creates a syncer that will fill in the flat state
+// corresponding to root.
+func NewSnapSyncer(root common.Hash) *SnapSyncer {
+	return &SnapSyncer{
+		root:  root,
+		tasks: []*snapRangeTask{{last: maxRangeHash}},
+	}
+}
+
+// AssignTask hands the caller the next outstanding range to request from a
+// peer, removing it from the pending queue. The caller must eventually call
+// either MarkDone (on a verified response) or Retry (on a failed or invalid
+// one) - the task isn't tracked anywhere else in the meantime.
+func (s *SnapSyncer) AssignTask() (*snapRangeTask, bool) {
+	if len(s.tasks) == 0 {
+		return nil, false
+	}
+	task := s.tasks[len(s.tasks)-1]
+	s.tasks = s.tasks[:len(s.tasks)-1]
+	return task, true
+}
+
+// MarkDone records that task's range proof verified and its leaves were
+// written to the flat snapshot layer. There's nothing left to track for it:
+// AssignTask already removed it from the pending queue.
+func (s *SnapSyncer) MarkDone(task *snapRangeTask) {}
+
+// Retry reassigns task to a new peer. Every other attempt it splits the
+// range in half first, on the assumption that a narrower range is more
+// likely to be servable (or at least fails faster) than a wide one that has
+// already timed out or come back with an invalid proof.
+func (s *SnapSyncer) Retry(task *snapRangeTask) {
+	task.retries++
+	if task.retries >= maxSnapRangeRetries || task.retries%2 == 1 {
+		s.tasks = append(s.tasks, task)
+		return
+	}
+	mid := midpoint(task.next, task.last)
+	if mid == task.next || mid == task.last {
+		s.tasks = append(s.tasks, task)
+		return
+	}
+	s.tasks = append(s.tasks,
+		&snapRangeTask{next: task.next, last: mid, retries: task.retries},
+		&snapRangeTask{next: mid, last: task.last, retries: task.retries},
+	)
+}
+
+// midpoint returns the key halfway between a and b.
+func midpoint(a, b common.Hash) common.Hash {
+	sum := new(big.Int).Add(new(big.Int).SetBytes(a[:]), new(big.Int).SetBytes(b[:]))
+	return common.BytesToHash(sum.Rsh(sum, 1).Bytes())
+}
+
+// Done reports whether every range has been filled in, meaning the syncer
+// is ready to move on to the healing phase.
+func (s *SnapSyncer) Done() bool {
+	return len(s.tasks) == 0
+}
+
+// QueueHeal records that the trie node(s) at the given paths are missing
+// from the target trie once diffed against what the flat ranges filled in,
+// and need to be fetched individually during the healing phase.
+func (s *SnapSyncer) QueueHeal(paths ...TrieNodePathSet) {
+	s.healQueue = append(s.healQueue, paths...)
+}
+
+// HealCallback fetches and persists the trie node at path, returning its
+// RLP encoding. It is supplied by the caller driving the healing phase,
+// which owns the actual peer requests and database writes.
+type HealCallback func(path TrieNodePathSet) ([]byte, error)
+
+// Heal drains the queue of trie node paths discovered missing while
+// processing range responses, invoking fetch for each in turn. It stops at
+// the first error, leaving the remaining paths queued for a later retry.
+func (s *SnapSyncer) Heal(fetch HealCallback) error {
+	for len(s.healQueue) > 0 {
+		path := s.healQueue[0]
+		if _, err := fetch(path); err != nil {
+			return err
+		}
+		s.healQueue = s.healQueue[1:]
+	}
+	return nil
+}
+
+// HealDone reports whether every range has been filled in and every
+// discovered-missing trie node has been healed.
+func (s *SnapSyncer) HealDone() bool {
+	return s.Done() && len(s.healQueue) == 0
+}
+
+// GetAccountRangePacket requests a contiguous run of accounts, keyed by hash,
+// starting at origin and bounded by limit, along with a Merkle proof for the
+// first and last returned key against root.
+type GetAccountRangePacket struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// AccountRangePacket is the response to a GetAccountRangePacket, carrying the
+// leaves found within the requested range plus a range proof bounding them.
+type AccountRangePacket struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*AccountData // Consecutive accounts from the trie
+	Proof    [][]byte       // Merkle proof for the first and last account
+}
+
+// AccountData is a single leaf in an AccountRangePacket.
+type AccountData struct {
+	Hash common.Hash // Hash of the account
+	Body []byte      // Account RLP body
+}
+
+// GetStorageRangesPacket requests the storage slots of one or more accounts,
+// analogous to GetAccountRangePacket but scoped per-account.
+type GetStorageRangesPacket struct {
+	ID       uint64
+	Root     common.Hash
+	Accounts []common.Hash
+	Origin   []byte
+	Limit    []byte
+	Bytes    uint64
+}
+
+// StorageRangesPacket is the response to a GetStorageRangesPacket.
+type StorageRangesPacket struct {
+	ID    uint64
+	Slots [][]*AccountData
+	Proof [][]byte
+}
+
+// GetByteCodesPacket requests the bytecodes for a batch of code hashes
+// discovered while processing an AccountRangePacket.
+type GetByteCodesPacket struct {
+	ID     uint64
+	Hashes []common.Hash
+	Bytes  uint64
+}
+
+// ByteCodesPacket is the response to a GetByteCodesPacket.
+type ByteCodesPacket struct {
+	ID    uint64
+	Codes [][]byte
+}
+
+// GetTrieNodesPacket requests raw trie nodes by path, used during the
+// healing phase once the flat ranges have all been filled in.
+type GetTrieNodesPacket struct {
+	ID    uint64
+	Root  common.Hash
+	Paths []TrieNodePathSet
+	Bytes uint64
+}
+
+// TrieNodePathSet identifies a trie node via the account (if any) it
+// belongs to plus its path from that trie's root.
+type TrieNodePathSet [][]byte
+
+// TrieNodesPacket is the response to a GetTrieNodesPacket.
+type TrieNodesPacket struct {
+	ID    uint64
+	Nodes [][]byte
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/abt/zerium/common"
+	"github.com/abt/zerium/core/bloombits"
+	"github.com/abt/zerium/core/types"
+	"github.com/abt/zerium/params"
+)
+
+// Filter resolves the logs matching (fromBlock, toBlock, addresses, topics).
+// It first consults whatever bloom-bits sections the backend's chain indexer
+// has already finished, and only falls back to a per-block bloom scan for
+// the unindexed tail above the latest finished section. This keeps
+// zrm_getLogs over large ranges proportional to the number of matches
+// instead of the number of blocks scanned.
+type Filter struct {
+	backend Backend
+
+	addresses []common.Address
+	topics    [][]common.Hash
+
+	block      common.Hash // Block hash if filtering a single block
+	begin, end int64       // Range interval if filtering multiple blocks
+
+	matcher *bloombits.Matcher
+}
+
+// Backend is the subset of the zrm.Zerium / les.LightZerium API the filter
+// needs: header/log access plus the section-matching pieces used to drive
+// the indexed fast path.
+type Backend interface {
+	HeaderByNumber(ctx context.Context, number int64) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error)
+
+	BloomStatus() (uint64, uint64)
+	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
+}
+
+// NewRangeFilter creates a new filter which matches logs within a range of
+// blocks, filtered on the given addresses/topics. Addresses within the same
+// filter criteria OR, while topic lists AND across position and OR within a
+// position, same as zrm_getLogs.
+func NewRangeFilter(backend Backend, begin, end int64, addresses []common.Address, topics [][]common.Hash) *Filter {
+	var filters [][][]byte
+	if len(addresses) > 0 {
+		filter := make([][]byte, len(addresses))
+		for i, address := range addresses {
+			filter[i] = address.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	for _, topicList := range topics {
+		if len(topicList) == 0 {
+			continue // wildcard position: no bloom bits to require
+		}
+		filter := make([][]byte, len(topicList))
+		for i, topic := range topicList {
+			filter[i] = topic.Bytes()
+		}
+		filters = append(filters, filter)
+	}
+	var matcher *bloombits.Matcher
+	if len(filters) > 0 {
+		matcher = bloombits.NewMatcher(params.BloomBitsBlocks, filters)
+	}
+	return &Filter{
+		backend:   backend,
+		addresses: addresses,
+		topics:    topics,
+		begin:     begin,
+		end:       end,
+		matcher:   matcher,
+	}
+}
+
+// NewBlockFilter creates a new filter which directly inspects the contents
+// of a single block, bypassing the indexed/bloom fast path entirely.
+func NewBlockFilter(backend Backend, block common.Hash, addresses []common.Address, topics [][]common.Hash) *Filter {
+	return &Filter{
+		backend:   backend,
+		addresses: addresses,
+		topics:    topics,
+		block:     block,
+	}
+}
+
+// Logs searches the blockchain for matching log entries, returning all
+// logs from blocks that match the filter criteria.
+func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
+	if f.block != (common.Hash{}) {
+		header, err := f.backend.HeaderByHash(ctx, f.block)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errors.New("unknown block")
+		}
+		return f.blockLogs(ctx, header)
+	}
+
+	head, err := f.backend.HeaderByNumber(ctx, -1)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("unknown head block")
+	}
+	end := f.end
+	if end < 0 || end > head.Number.Int64() {
+		end = head.Number.Int64()
+	}
+
+	var logs []*types.Log
+
+	// Indexed fast path: ask the chain indexer how many sections it has
+	// already finished and only fall back to scanning for the tail above
+	// that, same boundary the downloader's bloom indexer commits at.
+	sections, _ := f.backend.BloomStatus()
+	indexedEnd := int64(sections*params.BloomBitsBlocks) - 1
+
+	if f.matcher != nil && f.begin <= indexedEnd {
+		rangeEnd := end
+		if rangeEnd > indexedEnd {
+			rangeEnd = indexedEnd
+		}
+		indexed, err := f.indexedLogs(ctx, uint64(rangeEnd))
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, indexed...)
+		f.begin = rangeEnd + 1
+	}
+	if f.begin > end {
+		return logs, nil
+	}
+
+	tail, err := f.unindexedLogs(ctx, f.begin, end)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, tail...), nil
+}
+
+// indexedLogs walks the sections the backend's chain indexer has already
+// completed, consulting the bloom-bits matcher before fetching a block's
+// full receipts.
+func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	session := bloombits.NewMatcherSession(f.matcher, uint64(f.begin), end)
+	f.backend.ServiceFilter(ctx, session)
+	defer session.Close()
+
+	var logs []*types.Log
+	for {
+		number, ok := session.Next(ctx)
+		if !ok {
+			return logs, session.Error()
+		}
+		header, err := f.backend.HeaderByNumber(ctx, int64(number))
+		if err != nil || header == nil {
+			return logs, err
+		}
+		found, err := f.blockLogs(ctx, header)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, found...)
+	}
+}
+
+// unindexedLogs scans every block in [begin, end] directly, used for ranges
+// that fall above the chain indexer's latest finished section.
+func (f *Filter) unindexedLogs(ctx context.Context, begin, end int64) ([]*types.Log, error) {
+	var logs []*types.Log
+	for number := begin; number <= end; number++ {
+		header, err := f.backend.HeaderByNumber(ctx, number)
+		if err != nil || header == nil {
+			return logs, err
+		}
+		found, err := f.blockLogs(ctx, header)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, found...)
+	}
+	return logs, nil
+}
+
+// blockLogs returns the logs matching the filter criteria within a single
+// block.
+func (f *Filter) blockLogs(ctx context.Context, header *types.Header) ([]*types.Log, error) {
+	if !bloomFilter(header.Bloom, f.addresses, f.topics) {
+		return nil, nil
+	}
+	logsList, err := f.backend.GetLogs(ctx, header.Hash())
+	if err != nil {
+		return nil, err
+	}
+	var unfiltered []*types.Log
+	for _, logs := range logsList {
+		unfiltered = append(unfiltered, logs...)
+	}
+	return filterLogs(unfiltered, nil, nil, f.addresses, f.topics), nil
+}
+
+// filterLogs creates a slice of logs matching the given criteria.
+func filterLogs(logs []*types.Log, fromBlock, toBlock *big.Int, addresses []common.Address, topics [][]common.Hash) []*types.Log {
+	var ret []*types.Log
+Logs:
+	for _, log := range logs {
+		if fromBlock != nil && fromBlock.Int64() >= 0 && fromBlock.Uint64() > log.BlockNumber {
+			continue
+		}
+		if toBlock != nil && toBlock.Int64() >= 0 && toBlock.Uint64() < log.BlockNumber {
+			continue
+		}
+		if len(addresses) > 0 && !includes(addresses, log.Address) {
+			continue
+		}
+		if len(topics) > len(log.Topics) {
+			continue Logs
+		}
+		for i, topicList := range topics {
+			if len(topicList) == 0 {
+				continue // anything matches
+			}
+			if !includesHash(topicList, log.Topics[i]) {
+				continue Logs
+			}
+		}
+		ret = append(ret, log)
+	}
+	return ret
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+func includesHash(topics []common.Hash, topic common.Hash) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// bloomFilter reports whether the header's bloom filter could possibly
+// contain logs matching addresses/topics.
+func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		var included bool
+		for _, addr := range addresses {
+			if types.BloomLookup(bloom, addr) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, sub := range topics {
+		included := len(sub) == 0
+		for _, topic := range sub {
+			if types.BloomLookup(bloom, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 The zerium Authors
+// This file is part of the zerium library.
+//
+// The zerium library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The zerium library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the zerium library. If not, see <http://www.gnu.org/licenses/>.
+
+package zrm
+
+// Sub-protocol identifiers and message codes for snap/1, the flat-state
+// range-sync protocol used by downloader.SnapSyncer.
+//
+// These are defined now so wire-format work (encoding, packet types in
+// zrm/downloader) can proceed, but the protocol isn't registered with
+// Protocols() yet: that requires a ProtocolManager handler loop that reads
+// these message codes and drives a SnapSyncer, which doesn't exist yet.
+// Wire it in once that handler lands instead of advertising a sub-protocol
+// no peer can actually talk to.
+const (
+	snap1 = 1
+
+	SnapVersion = snap1
+)
+
+// snapProtocolLengths is the number of implemented messages corresponding to
+// different protocol versions, keyed by protocol version.
+var snapProtocolLengths = map[uint]uint64{snap1: 8}
+
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+	GetTrieNodesMsg     = 0x06
+	TrieNodesMsg        = 0x07
+)